@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// article_frontmatter is the subset of an article's optional YAML
+// frontmatter that wikka understands. Frontmatter is delimited by a line of
+// "---" at the very start of the content and a matching "---" below it, e.g.:
+//
+//	---
+//	allow_edit: [alice, group:editors]
+//	---
+//	# Page content starts here
+type article_frontmatter struct {
+	AllowEdit []string `yaml:"allow_edit"`
+}
+
+// split_frontmatter separates a leading YAML frontmatter block from the rest
+// of an article's content, returning the parsed frontmatter (zero value if
+// none is present) and the remaining body.
+func split_frontmatter(content string) (article_frontmatter, string) {
+	const delim = "---"
+
+	if !strings.HasPrefix(content, delim+"\n") {
+		return article_frontmatter{}, content
+	}
+
+	rest := content[len(delim)+1:]
+	end := strings.Index(rest, "\n"+delim)
+	if end == -1 {
+		return article_frontmatter{}, content
+	}
+
+	raw := rest[:end]
+	body := strings.TrimPrefix(rest[end+len(delim)+1:], "\n")
+
+	var front article_frontmatter
+	if err := yaml.Unmarshal([]byte(raw), &front); err != nil {
+		return article_frontmatter{}, content
+	}
+	return front, body
+}
+
+// article_body strips any frontmatter block, returning just the renderable
+// content of the article.
+func article_body(content string) string {
+	_, body := split_frontmatter(content)
+	return body
+}
+
+// article_acl reads the allow_edit list out of an article's frontmatter.
+// An article with no frontmatter, or no allow_edit entry, has no ACL.
+func article_acl(content string) []string {
+	front, _ := split_frontmatter(content)
+	return front.AllowEdit
+}
+
+// acl_allows reports whether user is permitted to edit an article guarded by
+// allow_edit. An empty acl means the article is unrestricted.
+func acl_allows(acl []string, user User) bool {
+	if len(acl) == 0 {
+		return true
+	}
+
+	for _, entry := range acl {
+		if entry == user.Name {
+			return true
+		}
+		if group, ok := strings.CutPrefix(entry, "group:"); ok {
+			for _, g := range user.Groups {
+				if g == group {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Mooxmirror/wikka/internal/activitypub"
+)
+
+var (
+	activitypub_key       *rsa.PrivateKey
+	activitypub_followers *follower_store
+	activitypub_outbox    *outbox_store
+
+	activitypub_seen_mu sync.Mutex
+	activitypub_seen    map[string]bool
+)
+
+// setup_activitypub loads the site actor's keypair and persisted state, and
+// starts the background publisher that turns article saves into outbox
+// activities until ctx is cancelled.
+func setup_activitypub(ctx context.Context) error {
+	key, err := load_or_create_activitypub_key(cfg.ActivityPubKey)
+	if err != nil {
+		return err
+	}
+	activitypub_key = key
+
+	followers, err := load_follower_store(cfg.FollowersPath)
+	if err != nil {
+		return err
+	}
+	activitypub_followers = followers
+
+	outbox, err := load_outbox_store(cfg.OutboxPath)
+	if err != nil {
+		return err
+	}
+	activitypub_outbox = outbox
+
+	activitypub_seen = make(map[string]bool)
+	for _, article := range store.List() {
+		activitypub_seen[strings.ToLower(article.Title)] = true
+	}
+
+	go watch_activitypub(ctx)
+	return nil
+}
+
+// watch_activitypub publishes a Create or Update activity for every saved
+// article until ctx is cancelled, driven by the store's change
+// notifications.
+func watch_activitypub(ctx context.Context) {
+	changes := store.Watch()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case article, ok := <-changes:
+			if !ok {
+				return
+			}
+			publish_article(article)
+		}
+	}
+}
+
+// publish_article records and delivers the Create/Update activity for a
+// saved article. The first time a title is seen it publishes as an
+// Article, and as a Note on every edit after that.
+func publish_article(article Article) {
+	slug := strings.ToLower(article.Title)
+
+	activitypub_seen_mu.Lock()
+	is_new := !activitypub_seen[slug]
+	activitypub_seen[slug] = true
+	activitypub_seen_mu.Unlock()
+
+	actor_url := cfg.Url + "/actor"
+	article_url := cfg.Url + "/" + article.Title
+	html_content := render_markdown(article_body(article.Content))
+
+	activity := activitypub.NewArticleActivity(actor_url, article_url, article.Title, html_content, article.ModifyDate, is_new)
+
+	if _, err := activitypub_outbox.append(activity); err != nil {
+		log.Println("activitypub: failed to record outbox entry for " + article.Title + ": " + err.Error())
+		return
+	}
+
+	deliver_activity(activity)
+}
+
+func handle_webfinger(res http.ResponseWriter, req *http.Request) {
+	host := host_from_url(cfg.Url)
+	resource := req.URL.Query().Get("resource")
+	if resource != "acct:"+cfg.ActorName+"@"+host {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	doc := activitypub.NewWebfinger(host, cfg.ActorName, cfg.Url+"/actor")
+	res.Header().Set("Content-Type", "application/jrd+json")
+	json.NewEncoder(res).Encode(doc)
+}
+
+func handle_actor(res http.ResponseWriter, req *http.Request) {
+	actor := activitypub.NewActor(cfg.Url, cfg.ActorName, cfg.Title)
+
+	public_pem, err := public_key_pem(activitypub_key)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	actor.PublicKey.PublicKeyPem = public_pem
+
+	res.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(res).Encode(actor)
+}
+
+func handle_outbox(res http.ResponseWriter, req *http.Request) {
+	collection := activitypub.NewOutbox(cfg.Url+"/outbox", activitypub_outbox.list())
+	res.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(res).Encode(collection)
+}
+
+// handle_inbox accepts Follow and Undo(Follow) activities from remote
+// actors, persisting or removing the follower accordingly.
+func handle_inbox(res http.ResponseWriter, req *http.Request) {
+	raw, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incoming struct {
+		Type   string          `json:"type"`
+		Actor  string          `json:"actor"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := json.Unmarshal(raw, &incoming); err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	remote, err := fetch_remote_actor(incoming.Actor)
+	if err != nil {
+		log.Println("activitypub: could not resolve " + incoming.Actor + ": " + err.Error())
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := activitypub.Verify(req, raw, remote.public_key); err != nil {
+		log.Println("activitypub: rejecting inbox request from " + incoming.Actor + ": " + err.Error())
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch incoming.Type {
+	case "Follow":
+		handle_follow(incoming.Actor, remote.inbox, raw)
+	case "Undo":
+		handle_unfollow(incoming.Actor, incoming.Object)
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// handle_follow persists the follower and replies with a signed Accept.
+func handle_follow(actor_iri string, inbox string, follow_body []byte) {
+	if err := activitypub_followers.add(follower{Actor: actor_iri, Inbox: inbox}); err != nil {
+		log.Println("activitypub: failed to persist follower " + actor_iri + ": " + err.Error())
+		return
+	}
+
+	accept, err := json.Marshal(map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       cfg.Url + "/actor#accept-" + actor_iri,
+		"type":     "Accept",
+		"actor":    cfg.Url + "/actor",
+		"object":   json.RawMessage(follow_body),
+	})
+	if err != nil {
+		log.Println("activitypub: failed to build accept for " + actor_iri + ": " + err.Error())
+		return
+	}
+
+	go deliver_to_inbox(inbox, accept)
+}
+
+// handle_unfollow removes the follower named by sender_actor, the
+// signature-verified actor that sent the Undo. The wrapped Follow's own
+// "actor" field is not trusted for this - the sender could name any actor
+// there and evict an unrelated follower.
+func handle_unfollow(sender_actor string, undo_object json.RawMessage) {
+	var undone struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(undo_object, &undone); err != nil || undone.Type != "Follow" {
+		return
+	}
+	if err := activitypub_followers.remove(sender_actor); err != nil {
+		log.Println("activitypub: failed to remove follower " + sender_actor + ": " + err.Error())
+	}
+}
+
+// remote_actor is the subset of a fetched ActivityPub actor document wikka
+// needs: where to deliver activities, and the key to verify requests signed
+// with it.
+type remote_actor struct {
+	inbox      string
+	public_key *rsa.PublicKey
+}
+
+// fetch_remote_actor GETs actor_iri's ActivityPub actor document and parses
+// out its inbox URL and public key.
+func fetch_remote_actor(actor_iri string) (*remote_actor, error) {
+	req, err := http.NewRequest("GET", actor_iri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+
+	resp, err := federation_client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var doc struct {
+		Inbox     string `json:"inbox"`
+		PublicKey struct {
+			PublicKeyPem string `json:"publicKeyPem"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Inbox == "" {
+		return nil, errors.New("activitypub: actor document has no inbox")
+	}
+
+	public_key, err := parse_public_key_pem(doc.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, err
+	}
+	return &remote_actor{inbox: doc.Inbox, public_key: public_key}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Mooxmirror/wikka/internal/activitypub"
+)
+
+// federation_client is used for every request to a remote server - actor
+// lookups and inbox deliveries alike - bounded so a slow or unresponsive
+// peer can't hang a goroutine forever.
+var federation_client = &http.Client{Timeout: 10 * time.Second}
+
+// deliver_activity signs activity with the site actor's private key and
+// POSTs it to every known follower's inbox. Deliveries run concurrently and
+// failures are logged, not retried - matching wikka's existing
+// best-effort notification style (see fs_article_store.notify).
+func deliver_activity(activity activitypub.Activity) {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		log.Println("activitypub: failed to marshal activity: " + err.Error())
+		return
+	}
+
+	for _, f := range activitypub_followers.list() {
+		go deliver_to_inbox(f.Inbox, body)
+	}
+}
+
+func deliver_to_inbox(inbox_url string, body []byte) {
+	req, err := http.NewRequest("POST", inbox_url, bytes.NewReader(body))
+	if err != nil {
+		log.Println("activitypub: failed to build delivery to " + inbox_url + ": " + err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+
+	if err := activitypub.Sign(req, cfg.Url+"/actor#main-key", activitypub_key, body); err != nil {
+		log.Println("activitypub: failed to sign delivery to " + inbox_url + ": " + err.Error())
+		return
+	}
+
+	resp, err := federation_client.Do(req)
+	if err != nil {
+		log.Println("activitypub: delivery to " + inbox_url + " failed: " + err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("activitypub: delivery to %s rejected with status %d\n", inbox_url, resp.StatusCode)
+	}
+}
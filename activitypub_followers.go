@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// follower is a remote actor who has Follow'd the site actor.
+type follower struct {
+	Actor string `json:"actor"`
+	Inbox string `json:"inbox"`
+}
+
+// follower_store is the persisted, concurrency-safe follower list backing
+// the /inbox Follow/Undo handlers and outbox delivery.
+type follower_store struct {
+	path string
+
+	mu        sync.Mutex
+	followers map[string]follower
+}
+
+func load_follower_store(path string) (*follower_store, error) {
+	s := &follower_store{path: path, followers: make(map[string]follower)}
+
+	content_bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var list []follower
+	if err := json.Unmarshal(content_bytes, &list); err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		s.followers[f.Actor] = f
+	}
+	return s, nil
+}
+
+func (s *follower_store) save() error {
+	list := make([]follower, 0, len(s.followers))
+	for _, f := range s.followers {
+		list = append(list, f)
+	}
+	content_bytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, content_bytes, 0644)
+}
+
+func (s *follower_store) add(f follower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.followers[f.Actor] = f
+	return s.save()
+}
+
+func (s *follower_store) remove(actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.followers, actor)
+	return s.save()
+}
+
+func (s *follower_store) list() []follower {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]follower, 0, len(s.followers))
+	for _, f := range s.followers {
+		list = append(list, f)
+	}
+	return list
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// load_or_create_activitypub_key reads the RSA keypair at path, generating
+// and persisting a fresh 2048-bit key the first time wikka federates.
+func load_or_create_activitypub_key(path string) (*rsa.PrivateKey, error) {
+	content_bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return generate_activitypub_key(path)
+	}
+
+	block, _ := pem.Decode(content_bytes)
+	if block == nil {
+		return nil, &invalid_key_file_error{path}
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func generate_activitypub_key(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	pem_bytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(path, pem_bytes, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+type invalid_key_file_error struct{ path string }
+
+func (e *invalid_key_file_error) Error() string {
+	return "activitypub: " + e.path + " does not contain a PEM-encoded private key"
+}
+
+// public_key_pem renders key's public half as a PEM block, for serving in
+// the actor document.
+func public_key_pem(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// parse_public_key_pem parses a remote actor's published RSA public key.
+func parse_public_key_pem(public_key_pem string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(public_key_pem))
+	if block == nil {
+		return nil, errors.New("activitypub: actor publicKeyPem is not PEM-encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsa_key, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("activitypub: actor public key is not RSA")
+	}
+	return rsa_key, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Mooxmirror/wikka/internal/activitypub"
+)
+
+// outbox_store is the persisted, append-only log of activities the site
+// actor has published, served back as the /outbox OrderedCollection.
+type outbox_store struct {
+	path string
+
+	mu         sync.Mutex
+	activities []activitypub.Activity
+}
+
+func load_outbox_store(path string) (*outbox_store, error) {
+	s := &outbox_store{path: path}
+
+	content_bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content_bytes, &s.activities); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// append records activity and returns the outbox in most-recent-first order.
+func (s *outbox_store) append(activity activitypub.Activity) ([]activitypub.Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activities = append(s.activities, activity)
+
+	content_bytes, err := json.Marshal(s.activities)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(s.path, content_bytes, 0644); err != nil {
+		return nil, err
+	}
+
+	ordered := make([]activitypub.Activity, len(s.activities))
+	for i, a := range s.activities {
+		ordered[len(s.activities)-1-i] = a
+	}
+	return ordered, nil
+}
+
+func (s *outbox_store) list() []activitypub.Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ordered := make([]activitypub.Activity, len(s.activities))
+	for i, a := range s.activities {
+		ordered[len(s.activities)-1-i] = a
+	}
+	return ordered
+}
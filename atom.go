@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Mooxmirror/wikka/internal/atom"
+)
+
+func host_from_url(raw_url string) string {
+	parsed, err := url.Parse(raw_url)
+	if err != nil || parsed.Host == "" {
+		return raw_url
+	}
+	return parsed.Host
+}
+
+func feed_start_date() time.Time {
+	if cfg.FeedStartDate == "" {
+		return time.Time{}
+	}
+	start_date, err := time.Parse("2006-01-02", cfg.FeedStartDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return start_date
+}
+
+func latest_modify_date(list []Article) time.Time {
+	var latest time.Time
+	for _, article := range list {
+		if article.ModifyDate.After(latest) {
+			latest = article.ModifyDate
+		}
+	}
+	return latest
+}
+
+// build_feed assembles an Atom feed of the most recently modified articles.
+func build_feed() *atom.Feed {
+	recent := store.List()
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].ModifyDate.After(recent[j].ModifyDate)
+	})
+
+	size := cfg.FeedSize
+	if size <= 0 || size > len(recent) {
+		size = len(recent)
+	}
+	recent = recent[:size]
+
+	host := host_from_url(cfg.Url)
+	start_date := feed_start_date()
+
+	feed := &atom.Feed{
+		Title:   cfg.Title,
+		ID:      atom.TagURI(host, start_date, "/"),
+		Updated: atom.Time(latest_modify_date(recent)),
+		Link: []atom.Link{
+			{Href: cfg.Url, Rel: "alternate"},
+			{Href: cfg.Url + "/feed.atom", Rel: "self"},
+		},
+	}
+	if cfg.FeedAuthor != "" {
+		feed.Author = &atom.Author{Name: cfg.FeedAuthor}
+	}
+
+	for _, article := range recent {
+		feed.Entries = append(feed.Entries, atom.Entry{
+			Title:   article.Title,
+			ID:      atom.TagURI(host, start_date, "/"+strings.ToLower(article.Title)),
+			Updated: atom.Time(article.ModifyDate),
+			Link:    atom.Link{Href: cfg.Url + "/" + article.Title, Rel: "alternate"},
+			Content: atom.Content{Type: "html", Body: render_markdown(article_body(article.Content))},
+		})
+	}
+
+	return feed
+}
+
+func handle_feed(res http.ResponseWriter, req *http.Request) {
+	output, err := build_feed().Marshal()
+	if err != nil {
+		res.WriteHeader(500)
+		fmt.Fprint(res, "Failed to render feed")
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	res.Write(output)
+}
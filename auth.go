@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// User identifies an authenticated principal, along with the groups used to
+// evaluate per-article allow_edit ACLs.
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Authenticator verifies the credentials on an inbound request. Authenticate
+// returns ok=false, not an error, when credentials are absent or invalid so
+// callers can fall through to a uniform "please sign in" response.
+// Implementations must be safe for concurrent use.
+type Authenticator interface {
+	Authenticate(req *http.Request) (User, bool)
+
+	// Challenge tells the client how to obtain credentials, e.g. by setting
+	// WWW-Authenticate or redirecting to a login URL.
+	Challenge(res http.ResponseWriter, req *http.Request)
+}
+
+// open_authenticator picks a backend based on cfg.AuthDriver. A nil
+// Authenticator (driver left blank) means edit/save run unauthenticated,
+// matching wikka's historical behavior.
+func open_authenticator() (Authenticator, error) {
+	switch cfg.AuthDriver {
+	case "htpasswd":
+		return new_htpasswd_authenticator(cfg.AuthHtpasswd)
+	case "oauth2":
+		return new_oauth_authenticator(cfg)
+	case "":
+		return nil, nil
+	default:
+		return nil, &unknown_auth_driver_error{cfg.AuthDriver}
+	}
+}
+
+type unknown_auth_driver_error struct{ driver string }
+
+func (e *unknown_auth_driver_error) Error() string {
+	return "unknown auth driver: " + e.driver
+}
+
+// auth *Authenticator is nil unless cfg.AuthDriver selects one.
+var auth Authenticator
+
+// require_auth_middleware enforces authentication and the target article's
+// allow_edit ACL on edit/save/revert routes. It is only installed when
+// cfg.Editable is true, and is a no-op when no Authenticator is configured.
+func require_auth_middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if auth == nil {
+			next(res, req)
+			return
+		}
+
+		user, ok := auth.Authenticate(req)
+		if !ok {
+			auth.Challenge(res, req)
+			return
+		}
+
+		article_name := strings.ToLower(req.URL.Query().Get(":article"))
+		if article, exists := store.Get(article_name); exists {
+			if !acl_allows(article_acl(article.Content), user) {
+				context := error_context(403, "Forbidden", user.Name+" is not allowed to edit "+article.Title)
+				res.WriteHeader(403)
+				context["content"] = render_template(error_template, context)
+				fmt.Fprint(res, render_template(container_template, context))
+				return
+			}
+		}
+
+		next(res, req)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswd_authenticator checks HTTP Basic Auth credentials against an
+// Apache-style htpasswd file ("user:$2y$..." bcrypt lines, one per line).
+// Groups aren't tracked by this backend, so allow_edit ACLs can only
+// reference usernames, not groups, when this driver is selected.
+type htpasswd_authenticator struct {
+	path string
+
+	mu     sync.RWMutex
+	hashes map[string]string
+}
+
+func new_htpasswd_authenticator(path string) (*htpasswd_authenticator, error) {
+	a := &htpasswd_authenticator{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload re-reads the htpasswd file from disk, replacing the in-memory
+// credential table.
+func (a *htpasswd_authenticator) reload() error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		hashes[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.hashes = hashes
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *htpasswd_authenticator) Authenticate(req *http.Request) (User, bool) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return User{}, false
+	}
+
+	a.mu.RLock()
+	hash, exists := a.hashes[username]
+	a.mu.RUnlock()
+	if !exists {
+		return User{}, false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return User{}, false
+	}
+	return User{Name: username}, true
+}
+
+func (a *htpasswd_authenticator) Challenge(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("WWW-Authenticate", `Basic realm="wikka"`)
+	res.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauth_session_cookie = "wikka_session"
+	oauth_state_cookie   = "wikka_oauth_state"
+	oauth_session_ttl    = 7 * 24 * time.Hour
+)
+
+// oauth_authenticator authenticates users against an OAuth2/OIDC provider.
+// It identifies the signed-in user from a signed session cookie minted by
+// handle_oauth_callback after the provider's authorization code is
+// exchanged and the userinfo endpoint is queried.
+type oauth_authenticator struct {
+	config        oauth2.Config
+	user_info_url string
+	secret        []byte
+}
+
+// oauth_userinfo is the subset of a standard OIDC userinfo response wikka
+// understands: the subject (or email, as a fallback) becomes the User.Name,
+// and "groups" - a non-standard but common claim - becomes User.Groups.
+type oauth_userinfo struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email"`
+	Groups  []string `json:"groups"`
+}
+
+func new_oauth_authenticator(cfg *Configuration) (*oauth_authenticator, error) {
+	if cfg.SessionSecret == "" {
+		return nil, errors.New("auth: SessionSecret must be set to use the oauth2 driver")
+	}
+
+	return &oauth_authenticator{
+		config: oauth2.Config{
+			ClientID:     cfg.OAuthClientID,
+			ClientSecret: cfg.OAuthClientSecret,
+			RedirectURL:  cfg.OAuthRedirectURL,
+			Scopes:       []string{"openid", "profile", "email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  cfg.OAuthAuthURL,
+				TokenURL: cfg.OAuthTokenURL,
+			},
+		},
+		user_info_url: cfg.OAuthUserInfoURL,
+		secret:        []byte(cfg.SessionSecret),
+	}, nil
+}
+
+func (a *oauth_authenticator) Authenticate(req *http.Request) (User, bool) {
+	cookie, err := req.Cookie(oauth_session_cookie)
+	if err != nil {
+		return User{}, false
+	}
+
+	name, groups, ok := a.verify_session(cookie.Value)
+	if !ok {
+		return User{}, false
+	}
+	return User{Name: name, Groups: groups}, true
+}
+
+// Challenge redirects the browser into the OAuth2 authorization flow,
+// stashing a random state value in a short-lived cookie to be checked on
+// callback.
+func (a *oauth_authenticator) Challenge(res http.ResponseWriter, req *http.Request) {
+	state, err := new_csrf_token()
+	if err != nil {
+		http.Error(res, "could not start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     oauth_state_cookie,
+		Value:    state,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   600,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(res, req, a.config.AuthCodeURL(state), http.StatusFound)
+}
+
+// handle_oauth_callback exchanges the authorization code for a token, looks
+// up the signed-in user, and mints a session cookie before sending the
+// browser back to the page it started from.
+func handle_oauth_callback(res http.ResponseWriter, req *http.Request) {
+	a, ok := auth.(*oauth_authenticator)
+	if !ok {
+		http.NotFound(res, req)
+		return
+	}
+
+	state_cookie, err := req.Cookie(oauth_state_cookie)
+	if err != nil || req.URL.Query().Get("state") != state_cookie.Value {
+		http.Error(res, "invalid oauth state", http.StatusBadRequest)
+		return
+	}
+
+	token, err := a.config.Exchange(context.Background(), req.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(res, "could not complete login", http.StatusBadGateway)
+		return
+	}
+
+	user, err := a.fetch_userinfo(req.Context(), token)
+	if err != nil {
+		http.Error(res, "could not complete login", http.StatusBadGateway)
+		return
+	}
+
+	session, err := a.sign_session(user.Name, user.Groups)
+	if err != nil {
+		http.Error(res, "could not complete login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     oauth_session_cookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   int(oauth_session_ttl.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(res, req, "/", http.StatusFound)
+}
+
+func (a *oauth_authenticator) fetch_userinfo(ctx context.Context, token *oauth2.Token) (User, error) {
+	client := a.config.Client(ctx, token)
+	resp, err := client.Get(a.user_info_url)
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return User{}, err
+	}
+
+	var info oauth_userinfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return User{}, err
+	}
+
+	name := info.Subject
+	if name == "" {
+		name = info.Email
+	}
+	if name == "" {
+		return User{}, errors.New("auth: userinfo response has neither sub nor email")
+	}
+	return User{Name: name, Groups: info.Groups}, nil
+}
+
+// sign_session packs an expiry, username and groups into an HMAC-signed
+// cookie value of the form "expiry,name,group1,group2.signature". Baking
+// the expiry into the signed payload means a captured cookie value stops
+// verifying once it's stale, independent of the cookie's own MaxAge.
+func (a *oauth_authenticator) sign_session(name string, groups []string) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(oauth_session_ttl).Unix(), 10)
+	fields := append([]string{expires, name}, groups...)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, ",")))
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return payload + "." + signature, nil
+}
+
+func (a *oauth_authenticator) verify_session(session string) (string, []string, bool) {
+	payload, signature, found := strings.Cut(session, ".")
+	if !found {
+		return "", nil, false
+	}
+
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) != 1 {
+		return "", nil, false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+
+	parts := strings.Split(string(decoded), ",")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, false
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", nil, false
+	}
+
+	return parts[1], parts[2:], true
+}
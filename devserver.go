@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// dev_mode is toggled on by the -dev flag and enables live-reloading.
+var dev_mode bool
+
+const dev_reload_script = `<script>
+(function () {
+	var source = new EventSource("/_dev/reload");
+	source.onmessage = function () { location.reload(); };
+})();
+</script>`
+
+// reload_hub fans out a reload notification to every connected /_dev/reload
+// client whenever the watcher sees an article or template change.
+type reload_hub_t struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+var reload_hub = &reload_hub_t{clients: make(map[chan struct{}]bool)}
+
+func (h *reload_hub_t) subscribe() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	h.clients[ch] = true
+	return ch
+}
+
+func (h *reload_hub_t) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, ch)
+	close(ch)
+}
+
+func (h *reload_hub_t) broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch_for_changes reloads articles/templates on disk changes until ctx is
+// cancelled, broadcasting a reload event to connected browsers each time.
+func watch_for_changes(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("Failed to start file watcher: " + err.Error())
+		return
+	}
+	defer watcher.Close()
+
+	for _, path := range []string{cfg.Articles, cfg.Templates} {
+		if err := watcher.Add(path); err != nil {
+			log.Println("Failed to watch " + path + ": " + err.Error())
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			fmt.Println("Detected change: " + event.Name)
+			load_articles(cfg.Articles)
+			load_templates(cfg.Templates)
+			reload_hub.broadcast()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("Watcher error: " + err.Error())
+		}
+	}
+}
+
+// handle_dev_reload is a Server-Sent Events endpoint that emits "reload"
+// whenever the filesystem watcher detects a change.
+func handle_dev_reload(res http.ResponseWriter, req *http.Request) {
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+
+	ch := reload_hub.subscribe()
+	defer reload_hub.unsubscribe(ch)
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(res, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// buffered_response_writer captures a handler's response so it can be
+// rewritten before reaching the client.
+type buffered_response_writer struct {
+	header http.Header
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *buffered_response_writer) Header() http.Header { return w.header }
+
+func (w *buffered_response_writer) Write(b []byte) (int, error) { return w.buf.Write(b) }
+
+func (w *buffered_response_writer) WriteHeader(status int) { w.status = status }
+
+// inject_dev_script appends the live-reload snippet to a rendered page,
+// just before </body> when present.
+func inject_dev_script(body []byte) []byte {
+	if idx := bytes.LastIndex(body, []byte("</body>")); idx != -1 {
+		injected := make([]byte, 0, len(body)+len(dev_reload_script))
+		injected = append(injected, body[:idx]...)
+		injected = append(injected, []byte(dev_reload_script)...)
+		injected = append(injected, body[idx:]...)
+		return injected
+	}
+	return append(body, []byte(dev_reload_script)...)
+}
+
+// dev_inject_middleware injects the live-reload snippet into every response
+// while dev_mode is on, and is a no-op otherwise.
+func dev_inject_middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !dev_mode {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		buffered := &buffered_response_writer{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(buffered, req)
+
+		for key, values := range buffered.header {
+			for _, value := range values {
+				res.Header().Add(key, value)
+			}
+		}
+		res.WriteHeader(buffered.status)
+
+		body := buffered.buf.Bytes()
+		if is_html_response(buffered.header, body) {
+			body = inject_dev_script(body)
+		}
+		res.Write(body)
+	})
+}
+
+// is_html_response reports whether a response is HTML and therefore safe to
+// append the live-reload <script> to. Routes like /feed.atom and /outbox
+// don't set a Content-Type on our buffered writer, so fall back to sniffing
+// the body the same way net/http would.
+func is_html_response(header http.Header, body []byte) bool {
+	content_type := header.Get("Content-Type")
+	if content_type == "" {
+		content_type = http.DetectContentType(body)
+	}
+	media_type, _, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		return false
+	}
+	return media_type == "text/html"
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	history_template = "history.template"
+	diff_template    = "diff.template"
+)
+
+// Revision is a single saved version of an article's content.
+type Revision struct {
+	ID         string    `json:"id"`
+	ModifyDate time.Time `json:"modify_date"`
+}
+
+// revision_dir returns the directory holding an article's revision log.
+func revision_dir(title string) string {
+	return cfg.Articles + title + "/"
+}
+
+func revision_index_path(title string) string {
+	return revision_dir(title) + "index.json"
+}
+
+func revision_path(title string, id string) string {
+	return revision_dir(title) + id + ".md"
+}
+
+func new_revision_id(t time.Time) string {
+	return fmt.Sprintf("%d", t.UnixNano())
+}
+
+// load_revision_index reads an article's revision index, returning an empty
+// slice if no revisions have been recorded yet.
+func load_revision_index(title string) ([]Revision, error) {
+	content_bytes, err := ioutil.ReadFile(revision_index_path(title))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Revision{}, nil
+		}
+		return nil, err
+	}
+
+	var revisions []Revision
+	if err := json.Unmarshal(content_bytes, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func save_revision_index(title string, revisions []Revision) error {
+	content_bytes, err := json.Marshal(revisions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(revision_index_path(title), content_bytes, 0644)
+}
+
+// snapshot_revision archives content as a new revision of title and appends
+// it to the revision index.
+func snapshot_revision(title string, content string, modify_date time.Time) (Revision, error) {
+	if err := os.MkdirAll(revision_dir(title), 0755); err != nil {
+		return Revision{}, err
+	}
+
+	revision := Revision{ID: new_revision_id(modify_date), ModifyDate: modify_date}
+	if err := ioutil.WriteFile(revision_path(title, revision.ID), []byte(content), 0644); err != nil {
+		return Revision{}, err
+	}
+
+	revisions, err := load_revision_index(title)
+	if err != nil {
+		return Revision{}, err
+	}
+	revisions = append(revisions, revision)
+	if err := save_revision_index(title, revisions); err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+func read_revision(title string, id string) (string, error) {
+	content_bytes, err := ioutil.ReadFile(revision_path(title, id))
+	if err != nil {
+		return "", err
+	}
+	return string(content_bytes), nil
+}
+
+func render_revision_list(title string, revisions []Revision, csrf_token string) string {
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].ModifyDate.After(revisions[j].ModifyDate)
+	})
+
+	var list strings.Builder
+	list.WriteString("<ul class=\"revision-list\">")
+	for i, revision := range revisions {
+		list.WriteString("<li><a href=\"/" + title + "/revision/" + revision.ID + "\">" + format_date(revision.ModifyDate) + "</a>")
+		if i+1 < len(revisions) {
+			previous := revisions[i+1]
+			list.WriteString(" &middot; <a href=\"/" + title + "/diff/" + previous.ID + "/" + revision.ID + "\">diff</a>")
+		}
+		list.WriteString(" &middot; <form method=\"POST\" action=\"/" + title + "/revert/" + revision.ID + "\" style=\"display:inline\">")
+		list.WriteString("<input type=\"hidden\" name=\"csrf_token\" value=\"" + html.EscapeString(csrf_token) + "\">")
+		list.WriteString("<button type=\"submit\">revert</button></form>")
+		list.WriteString("</li>")
+	}
+	list.WriteString("</ul>")
+	return list.String()
+}
+
+// unified_diff_lines computes a simple line-based diff between a and b,
+// prefixing unchanged lines with two spaces, removed lines with "- " and
+// added lines with "+ ".
+func unified_diff_lines(a []string, b []string) []string {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < n && j < m {
+		if a[i] == b[j] {
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			out = append(out, "- "+a[i])
+			i++
+		} else {
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, "- "+a[i])
+	}
+	for ; j < m; j++ {
+		out = append(out, "+ "+b[j])
+	}
+	return out
+}
+
+func render_unified_diff(label_a string, label_b string, content_a string, content_b string) string {
+	diff_lines := unified_diff_lines(strings.Split(content_a, "\n"), strings.Split(content_b, "\n"))
+
+	var buf strings.Builder
+	buf.WriteString("<pre class=\"diff\">--- " + html.EscapeString(label_a) + "\n+++ " + html.EscapeString(label_b) + "\n")
+	for _, line := range diff_lines {
+		buf.WriteString(html.EscapeString(line) + "\n")
+	}
+	buf.WriteString("</pre>")
+	return buf.String()
+}
+
+func handle_history(res http.ResponseWriter, req *http.Request) {
+	article_name := strings.ToLower(req.URL.Query().Get(":article"))
+
+	article, exists := store.Get(article_name)
+	if !exists {
+		context := error_context(404, "Not found", article_name+" was not found.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	revisions, err := load_revision_index(article.Title)
+	if err != nil {
+		context := error_context(500, "Internal server error", "Could not load revision history")
+		res.WriteHeader(500)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	csrf_token, err := issue_csrf_cookie(res)
+	if err != nil {
+		context := error_context(500, "Internal server error", "Could not prepare the history page")
+		res.WriteHeader(500)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	context := article.CreateContext()
+	context["History.List"] = render_revision_list(article.Title, revisions, csrf_token)
+	context["content"] = render_template(history_template, context)
+	fmt.Fprint(res, render_template(container_template, context))
+}
+
+func handle_revision(res http.ResponseWriter, req *http.Request) {
+	article_name := strings.ToLower(req.URL.Query().Get(":article"))
+	revision_id := req.URL.Query().Get(":id")
+
+	article, exists := store.Get(article_name)
+	if !exists {
+		context := error_context(404, "Not found", article_name+" was not found.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	content, err := read_revision(article.Title, revision_id)
+	if err != nil {
+		context := error_context(404, "Revision not found", "That revision of "+article.Title+" does not exist.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	revision_article := Article{article.Title, article.ModifyDate, content}
+	context := revision_article.CreateContext()
+	context["Revision.ID"] = revision_id
+	context["content"] = render_template(view_template, context)
+	fmt.Fprint(res, render_template(container_template, context))
+}
+
+func handle_diff(res http.ResponseWriter, req *http.Request) {
+	article_name := strings.ToLower(req.URL.Query().Get(":article"))
+	revision_a := req.URL.Query().Get(":a")
+	revision_b := req.URL.Query().Get(":b")
+
+	article, exists := store.Get(article_name)
+	if !exists {
+		context := error_context(404, "Not found", article_name+" was not found.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	content_a, err_a := read_revision(article.Title, revision_a)
+	content_b, err_b := read_revision(article.Title, revision_b)
+	if err_a != nil || err_b != nil {
+		context := error_context(404, "Revision not found", "One of those revisions of "+article.Title+" does not exist.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	context := article.CreateContext()
+	context["Diff.A"] = revision_a
+	context["Diff.B"] = revision_b
+	context["Diff.Unified"] = render_unified_diff(revision_a, revision_b, content_a, content_b)
+	context["content"] = render_template(diff_template, context)
+	fmt.Fprint(res, render_template(container_template, context))
+}
+
+func handle_revert(res http.ResponseWriter, req *http.Request) {
+	if !check_csrf(req) {
+		context := error_context(403, "Forbidden", "That form has expired, please try again.")
+		res.WriteHeader(403)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	article_name := strings.ToLower(req.URL.Query().Get(":article"))
+	revision_id := req.URL.Query().Get(":id")
+
+	article, exists := store.Get(article_name)
+	if !exists {
+		context := error_context(404, "Not found", article_name+" was not found.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	content, err := read_revision(article.Title, revision_id)
+	if err != nil {
+		context := error_context(404, "Revision not found", "That revision of "+article.Title+" does not exist.")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	now := time.Now()
+	article.Content = content
+	article.ModifyDate = now
+	if err := store.Put(article); err != nil {
+		context := error_context(500, "Internal server error", "Could not revert "+article.Title)
+		res.WriteHeader(500)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+	index_article(article)
+
+	if _, err := snapshot_revision(article.Title, article.Content, now); err != nil {
+		fmt.Println("Failed to record revision for " + article.Title)
+	}
+
+	http.Redirect(res, req, "/"+article.Title, 301)
+}
@@ -0,0 +1,152 @@
+// Package activitypub builds the minimal set of ActivityPub/ActivityStreams
+// documents wikka needs to federate: a single site Actor, WebFinger
+// discovery for it, and Create/Update activities wrapping an Article.
+package activitypub
+
+import (
+	"fmt"
+	"time"
+)
+
+const context = "https://www.w3.org/ns/activitystreams"
+
+// PublicKey is an actor's published RSA public key, used by remote servers
+// to verify HTTP Signatures on activities delivered to their inbox.
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Actor is a single-user (site-wide) ActivityPub actor document.
+type Actor struct {
+	Context           string    `json:"@context"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+// NewActor builds the site actor document served at /actor.
+func NewActor(base_url string, username string, site_title string) Actor {
+	return Actor{
+		Context:           context,
+		ID:                base_url + "/actor",
+		Type:              "Service",
+		PreferredUsername: username,
+		Name:              site_title,
+		Inbox:             base_url + "/inbox",
+		Outbox:            base_url + "/outbox",
+		PublicKey: PublicKey{
+			ID:    base_url + "/actor#main-key",
+			Owner: base_url + "/actor",
+		},
+	}
+}
+
+// WebfingerLink is one entry in a WebFinger response's "links" array.
+type WebfingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// Webfinger is the JRD document served at /.well-known/webfinger.
+type Webfinger struct {
+	Subject string          `json:"subject"`
+	Links   []WebfingerLink `json:"links"`
+}
+
+// NewWebfinger builds the WebFinger response identifying the site actor as
+// acct:username@host.
+func NewWebfinger(host string, username string, actor_url string) Webfinger {
+	return Webfinger{
+		Subject: "acct:" + username + "@" + host,
+		Links: []WebfingerLink{
+			{Rel: "self", Type: `application/activity+json`, Href: actor_url},
+		},
+	}
+}
+
+// Object is an ActivityStreams object: an Article (long-form, as wikka
+// pages are edited in place rather than posted once) or a Note.
+type Object struct {
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Name         string   `json:"name,omitempty"`
+	Content      string   `json:"content"`
+	URL          string   `json:"url"`
+	Published    string   `json:"published"`
+	To           []string `json:"to"`
+}
+
+// Activity is a Create or Update activity wrapping an Object.
+type Activity struct {
+	Context   string   `json:"@context"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Object    Object   `json:"object"`
+	Published string   `json:"published"`
+	To        []string `json:"to"`
+}
+
+const public_collection = "https://www.w3.org/ns/activitystreams#Public"
+
+// NewArticleActivity builds the Create (new article) or Update (edited
+// article) activity to publish for a saved page. The wrapped object's type
+// is always Article - the Create/Update distinction on the Activity itself
+// is what tells a consumer whether this is a first publication or a
+// follow-up revision of the same object id.
+func NewArticleActivity(actor_url string, article_url string, title string, html_content string, published time.Time, is_new bool) Activity {
+	activity_type := "Create"
+	if !is_new {
+		activity_type = "Update"
+	}
+
+	object := Object{
+		ID:           article_url,
+		Type:         "Article",
+		AttributedTo: actor_url,
+		Name:         title,
+		Content:      html_content,
+		URL:          article_url,
+		Published:    published.UTC().Format(time.RFC3339),
+		To:           []string{public_collection},
+	}
+
+	return Activity{
+		Context:   context,
+		ID:        article_url + "#" + activity_type + "-" + fmt.Sprintf("%d", published.UnixNano()),
+		Type:      activity_type,
+		Actor:     actor_url,
+		Object:    object,
+		Published: object.Published,
+		To:        object.To,
+	}
+}
+
+// OrderedCollection is the outbox: a reverse-chronological log of the
+// activities published so far.
+type OrderedCollection struct {
+	Context      string     `json:"@context"`
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	TotalItems   int        `json:"totalItems"`
+	OrderedItems []Activity `json:"orderedItems"`
+}
+
+// NewOutbox wraps activities (most recent first) as the actor's outbox.
+func NewOutbox(outbox_url string, activities []Activity) OrderedCollection {
+	return OrderedCollection{
+		Context:      context,
+		ID:           outbox_url,
+		Type:         "OrderedCollection",
+		TotalItems:   len(activities),
+		OrderedItems: activities,
+	}
+}
@@ -0,0 +1,112 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sign attaches a Digest header over body and a draft-cavage HTTP Signature
+// over (request-target), host, date and digest, as expected by Mastodon and
+// most other ActivityPub servers for inbox deliveries.
+func Sign(req *http.Request, key_id string, private_key *rsa.PrivateKey, body []byte) error {
+	digest := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	signed_headers := []string{"(request-target)", "host", "date", "digest"}
+	signing_string := build_signing_string(req, signed_headers)
+
+	hashed := sha256.Sum256([]byte(signing_string))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, private_key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		key_id, strings.Join(signed_headers, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// ParsedSignature is a decoded draft-cavage Signature header.
+type ParsedSignature struct {
+	KeyID     string
+	Headers   []string
+	Signature []byte
+}
+
+// ParseSignatureHeader decodes a Signature header's comma-separated
+// key="value" pairs.
+func ParseSignatureHeader(header string) (ParsedSignature, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = strings.Trim(value, `"`)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(fields["signature"])
+	if err != nil {
+		return ParsedSignature{}, err
+	}
+
+	headers := strings.Fields(fields["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+
+	return ParsedSignature{KeyID: fields["keyId"], Headers: headers, Signature: signature}, nil
+}
+
+// Verify checks req's Signature header against the sender's RSA public key
+// and, when present, that its Digest header matches body.
+func Verify(req *http.Request, body []byte, public_key *rsa.PublicKey) error {
+	header := req.Header.Get("Signature")
+	if header == "" {
+		return errors.New("activitypub: request has no Signature header")
+	}
+
+	parsed, err := ParseSignatureHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if digest := req.Header.Get("Digest"); digest != "" {
+		sum := sha256.Sum256(body)
+		if digest != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+			return errors.New("activitypub: digest does not match request body")
+		}
+	}
+
+	signing_string := build_signing_string(req, parsed.Headers)
+	hashed := sha256.Sum256([]byte(signing_string))
+	return rsa.VerifyPKCS1v15(public_key, crypto.SHA256, hashed[:], parsed.Signature)
+}
+
+func build_signing_string(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, header := range headers {
+		switch header {
+		case "(request-target)":
+			lines = append(lines, "(request-target): "+strings.ToLower(req.Method)+" "+req.URL.Path)
+		case "host":
+			lines = append(lines, "host: "+req.Host)
+		default:
+			lines = append(lines, strings.ToLower(header)+": "+req.Header.Get(header))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,60 @@
+// Package atom builds minimal Atom 1.0 feeds.
+package atom
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    []Link   `xml:"link"`
+	Author  *Author  `xml:"author,omitempty"`
+	Entries []Entry  `xml:"entry"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type Entry struct {
+	Title   string  `xml:"title"`
+	ID      string  `xml:"id"`
+	Updated string  `xml:"updated"`
+	Link    Link    `xml:"link"`
+	Content Content `xml:"content"`
+}
+
+// TagURI builds a tag: URI (RFC 4151) for a stable, host/date-scoped feed
+// entry ID that survives the entry's URL changing.
+func TagURI(host string, start_date time.Time, path string) string {
+	return fmt.Sprintf("tag:%s,%s:%s", host, start_date.Format("2006-01-02"), path)
+}
+
+// Time formats t the way Atom's <updated> element expects.
+func Time(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Marshal renders the feed as a complete, declaration-prefixed Atom document.
+func (f *Feed) Marshal() ([]byte, error) {
+	output, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), output...), nil
+}
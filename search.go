@@ -0,0 +1,213 @@
+package main
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const search_template = "search.template"
+
+const (
+	bm25_k1 = 1.2
+	bm25_b  = 0.75
+)
+
+var token_pattern = regexp.MustCompile("[a-z0-9]+")
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "was": true, "will": true, "with": true,
+}
+
+// search_index maps token -> article title -> term frequency.
+var search_index map[string]map[string]int
+
+// doc_lengths maps article title -> number of indexed tokens.
+var doc_lengths map[string]int
+
+type search_result struct {
+	Title   string
+	Score   float64
+	Snippet string
+}
+
+func reset_search_index() {
+	search_index = make(map[string]map[string]int)
+	doc_lengths = make(map[string]int)
+}
+
+// tokenize lowercases text, strips punctuation, splits on whitespace and
+// drops stopwords.
+func tokenize(text string) []string {
+	raw := token_pattern.FindAllString(strings.ToLower(text), -1)
+	tokens := make([]string, 0, len(raw))
+	for _, token := range raw {
+		if stopwords[token] {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// index_article (re)indexes an article's content, replacing any previous
+// entry for the same title.
+func index_article(article Article) {
+	remove_from_index(article.Title)
+
+	tokens := tokenize(article.Content)
+	doc_lengths[article.Title] = len(tokens)
+
+	tf := make(map[string]int)
+	for _, token := range tokens {
+		tf[token]++
+	}
+	for token, count := range tf {
+		if search_index[token] == nil {
+			search_index[token] = make(map[string]int)
+		}
+		search_index[token][article.Title] = count
+	}
+}
+
+func remove_from_index(title string) {
+	for _, postings := range search_index {
+		delete(postings, title)
+	}
+	delete(doc_lengths, title)
+}
+
+func average_doc_length() float64 {
+	if len(doc_lengths) == 0 {
+		return 0
+	}
+	total := 0
+	for _, length := range doc_lengths {
+		total += length
+	}
+	return float64(total) / float64(len(doc_lengths))
+}
+
+// bm25_score scores title against query_tokens using Okapi BM25.
+func bm25_score(query_tokens []string, title string) float64 {
+	n := float64(len(doc_lengths))
+	avgdl := average_doc_length()
+	dl := float64(doc_lengths[title])
+
+	score := 0.0
+	for _, token := range query_tokens {
+		postings, ok := search_index[token]
+		if !ok {
+			continue
+		}
+		tf, ok := postings[title]
+		if !ok {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log((n-df+0.5)/(df+0.5) + 1)
+		numerator := float64(tf) * (bm25_k1 + 1)
+		denominator := float64(tf) + bm25_k1*(1-bm25_b+bm25_b*(dl/avgdl))
+		score += idf * (numerator / denominator)
+	}
+	return score
+}
+
+// search_articles ranks indexed articles against query with BM25 and
+// returns the top 20 matches with highlighted snippets.
+func search_articles(query string) []search_result {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, token := range tokens {
+		for title := range search_index[token] {
+			if !seen[title] {
+				seen[title] = true
+				candidates = append(candidates, title)
+			}
+		}
+	}
+
+	results := make([]search_result, 0, len(candidates))
+	for _, title := range candidates {
+		article, _ := store.Get(strings.ToLower(title))
+		results = append(results, search_result{
+			Title:   article.Title,
+			Score:   bm25_score(tokens, title),
+			Snippet: highlight_snippet(article.Content, tokens),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > 20 {
+		results = results[:20]
+	}
+	return results
+}
+
+// highlight_snippet returns an HTML-escaped ~200 character window around the
+// earliest query match, wrapping matched tokens in <mark>.
+func highlight_snippet(content string, tokens []string) string {
+	const window = 200
+
+	lower := strings.ToLower(content)
+	earliest := -1
+	for _, token := range tokens {
+		if idx := strings.Index(lower, token); idx != -1 && (earliest == -1 || idx < earliest) {
+			earliest = idx
+		}
+	}
+	if earliest == -1 {
+		earliest = 0
+	}
+
+	start := earliest - window/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + window
+	if end > len(content) {
+		end = len(content)
+	}
+
+	matches := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		matches[token] = true
+	}
+
+	words := strings.Fields(content[start:end])
+	for i, word := range words {
+		bare := strings.Join(token_pattern.FindAllString(strings.ToLower(word), -1), "")
+		if matches[bare] {
+			words[i] = "<mark>" + html.EscapeString(word) + "</mark>"
+		} else {
+			words[i] = html.EscapeString(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func render_search_results(results []search_result) string {
+	var list strings.Builder
+	list.WriteString("<ul class=\"search-results\">")
+	for _, result := range results {
+		list.WriteString("<li><a href=\"/" + strings.ToLower(result.Title) + "\">" + html.EscapeString(result.Title) + "</a><p>" + result.Snippet + "</p></li>")
+	}
+	list.WriteString("</ul>")
+	return list.String()
+}
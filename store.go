@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ArticleStore is the storage backend for articles. Implementations must be
+// safe for concurrent use.
+type ArticleStore interface {
+	Get(title string) (Article, bool)
+	Put(article Article) error
+	Delete(title string) error
+	List() []Article
+	Watch() <-chan Article
+}
+
+// open_article_store picks a backend based on cfg.StoreDriver, defaulting to
+// the filesystem-backed store rooted at path.
+func open_article_store(path string) (ArticleStore, error) {
+	switch cfg.StoreDriver {
+	case "sqlite":
+		return new_sqlite_article_store(cfg.StoreDSN)
+	default:
+		return new_fs_article_store(path)
+	}
+}
+
+// fs_article_store is the original flat-file-per-article backend, now
+// guarded by a mutex so concurrent saves no longer race on the map.
+type fs_article_store struct {
+	mu       sync.RWMutex
+	path     string
+	articles map[string]Article
+
+	watchers_mu sync.Mutex
+	watchers    []chan Article
+}
+
+func new_fs_article_store(path string) (*fs_article_store, error) {
+	store := &fs_article_store{path: path, articles: make(map[string]Article)}
+
+	info, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range info {
+		if !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+
+		content_bytes, err := ioutil.ReadFile(path + file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		title := strings.Split(file.Name(), ".")[0]
+		article := Article{title, file.ModTime(), string(content_bytes)}
+		store.articles[strings.ToLower(title)] = article
+		fmt.Println("Loaded article " + file.Name())
+	}
+
+	return store, nil
+}
+
+func (s *fs_article_store) Get(title string) (Article, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	article, exists := s.articles[strings.ToLower(title)]
+	return article, exists
+}
+
+func (s *fs_article_store) Put(article Article) error {
+	s.mu.Lock()
+	err := ioutil.WriteFile(s.path+article.Title+".md", []byte(article.Content), 0644)
+	if err == nil {
+		s.articles[strings.ToLower(article.Title)] = article
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.notify(article)
+	return nil
+}
+
+func (s *fs_article_store) Delete(title string) error {
+	key := strings.ToLower(title)
+
+	s.mu.Lock()
+	article, exists := s.articles[key]
+	delete(s.articles, key)
+	s.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return os.Remove(s.path + article.Title + ".md")
+}
+
+func (s *fs_article_store) List() []Article {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Article, 0, len(s.articles))
+	for _, article := range s.articles {
+		list = append(list, article)
+	}
+	return list
+}
+
+func (s *fs_article_store) Watch() <-chan Article {
+	ch := make(chan Article, 8)
+	s.watchers_mu.Lock()
+	s.watchers = append(s.watchers, ch)
+	s.watchers_mu.Unlock()
+	return ch
+}
+
+func (s *fs_article_store) notify(article Article) {
+	s.watchers_mu.Lock()
+	defer s.watchers_mu.Unlock()
+	for _, ch := range s.watchers {
+		select {
+		case ch <- article:
+		default:
+			log.Println("Dropping article store notification, watcher is not keeping up")
+		}
+	}
+}
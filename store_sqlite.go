@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlite_article_store is a database/sql-backed ArticleStore. database/sql
+// already serializes access to the underlying *sql.DB, so no extra locking
+// is needed there; the watcher list gets its own mutex.
+type sqlite_article_store struct {
+	db *sql.DB
+
+	watchers_mu sync.Mutex
+	watchers    []chan Article
+}
+
+// Revision history (see history.go) is kept on the filesystem under
+// cfg.Articles regardless of which ArticleStore backend is active, so this
+// schema only needs to hold the current state of each article.
+const sqlite_schema = `
+CREATE TABLE IF NOT EXISTS articles (
+	slug        TEXT PRIMARY KEY,
+	title       TEXT NOT NULL,
+	content     TEXT NOT NULL,
+	modify_date DATETIME NOT NULL
+);`
+
+func new_sqlite_article_store(dsn string) (*sqlite_article_store, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqlite_schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlite_article_store{db: db}, nil
+}
+
+func (s *sqlite_article_store) Get(title string) (Article, bool) {
+	row := s.db.QueryRow("SELECT title, content, modify_date FROM articles WHERE slug = ?", strings.ToLower(title))
+
+	var article Article
+	if err := row.Scan(&article.Title, &article.Content, &article.ModifyDate); err != nil {
+		return Article{}, false
+	}
+	return article, true
+}
+
+// Put upserts the article's current content.
+func (s *sqlite_article_store) Put(article Article) error {
+	slug := strings.ToLower(article.Title)
+
+	_, err := s.db.Exec(`
+		INSERT INTO articles (slug, title, content, modify_date) VALUES (?, ?, ?, ?)
+		ON CONFLICT(slug) DO UPDATE SET content = excluded.content, modify_date = excluded.modify_date`,
+		slug, article.Title, article.Content, article.ModifyDate)
+	if err != nil {
+		return err
+	}
+
+	s.notify(article)
+	return nil
+}
+
+func (s *sqlite_article_store) Delete(title string) error {
+	_, err := s.db.Exec("DELETE FROM articles WHERE slug = ?", strings.ToLower(title))
+	return err
+}
+
+func (s *sqlite_article_store) List() []Article {
+	rows, err := s.db.Query("SELECT title, content, modify_date FROM articles")
+	if err != nil {
+		log.Println("Failed to list articles: " + err.Error())
+		return nil
+	}
+	defer rows.Close()
+
+	var list []Article
+	for rows.Next() {
+		var article Article
+		if err := rows.Scan(&article.Title, &article.Content, &article.ModifyDate); err != nil {
+			log.Println("Failed to scan article row: " + err.Error())
+			continue
+		}
+		list = append(list, article)
+	}
+	return list
+}
+
+func (s *sqlite_article_store) Watch() <-chan Article {
+	ch := make(chan Article, 8)
+	s.watchers_mu.Lock()
+	s.watchers = append(s.watchers, ch)
+	s.watchers_mu.Unlock()
+	return ch
+}
+
+func (s *sqlite_article_store) notify(article Article) {
+	s.watchers_mu.Lock()
+	defer s.watchers_mu.Unlock()
+	for _, ch := range s.watchers {
+		select {
+		case ch <- article:
+		default:
+			log.Println("Dropping article store notification, watcher is not keeping up")
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/bmizerany/pat"
 	"github.com/microcosm-cc/bluemonday"
@@ -10,19 +12,40 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 )
 
 type Configuration struct {
-	Title     string
-	Url       string
-	Articles  string
-	Templates string
-	Host      string
-	Frontpage string
-	Editable  bool
+	Title             string
+	Url               string
+	Articles          string
+	Templates         string
+	Host              string
+	Frontpage         string
+	Editable          bool
+	FeedAuthor        string
+	FeedSize          int
+	FeedStartDate     string
+	StoreDriver       string
+	StoreDSN          string
+	AuthDriver        string
+	AuthHtpasswd      string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthAuthURL      string
+	OAuthTokenURL     string
+	OAuthUserInfoURL  string
+	OAuthRedirectURL  string
+	SessionSecret     string
+	ActivityPub       bool
+	ActorName         string
+	ActivityPubKey    string
+	FollowersPath     string
+	OutboxPath        string
 }
 
 type Article struct {
@@ -39,35 +62,21 @@ const (
 )
 
 var templates map[string]string
-var articles map[string]Article
+var store ArticleStore
 var cfg *Configuration
 
-// load all articles from a specific path
+// load_articles (re)opens the configured ArticleStore and rebuilds the
+// search index from it.
 func load_articles(path string) {
-	articles = make(map[string]Article)
-	info, err := ioutil.ReadDir(path)
-
+	opened, err := open_article_store(path)
 	if err != nil {
-		log.Fatal("Failed to load articles: " + path)
+		log.Fatal("Failed to load articles: " + err.Error())
 	}
+	store = opened
 
-	for _, file := range info {
-		isTemplate := strings.HasSuffix(file.Name(), ".md")
-
-		if isTemplate {
-			content_bytes, err := ioutil.ReadFile(path + file.Name())
-
-			if err != nil {
-				log.Fatal("Failed to read article: " + path + file.Name())
-			}
-
-			content := string(content_bytes)
-			title := strings.Split(file.Name(), ".")[0]
-			article := Article{title, file.ModTime(), content}
-
-			articles[strings.ToLower(title)] = article
-			fmt.Println("Loaded article " + file.Name())
-		}
+	reset_search_index()
+	for _, article := range store.List() {
+		index_article(article)
 	}
 }
 
@@ -139,7 +148,7 @@ func (art *Article) CreateContext() map[string]string {
 		"Wiki.Title":         cfg.Title,
 		"Wiki.Url":           cfg.Url,
 		"Article.Title":      art.Title,
-		"Article.Content":    render_markdown(art.Content),
+		"Article.Content":    render_markdown(article_body(art.Content)),
 		"Article.RawContent": art.Content,
 		"Article.ModifyDate": format_date(art.ModifyDate),
 	}
@@ -169,11 +178,11 @@ func handle_view(res http.ResponseWriter, req *http.Request) {
 	context := make(map[string]string)
 	active_template := ""
 
-	if article, exists := articles[article_name]; exists {
+	if article, exists := store.Get(article_name); exists {
 		context = article.CreateContext()
 		active_template = view_template
 	} else {
-		context = error_context(200, "Not found", article_name + " was not found. You may want to <a href=\"" + article_name + "/edit\">create this page!</a>")
+		context = error_context(200, "Not found", article_name+" was not found. You may want to <a href=\""+article_name+"/edit\">create this page!</a>")
 		active_template = error_template
 	}
 
@@ -185,42 +194,73 @@ func handle_edit(res http.ResponseWriter, req *http.Request) {
 	article_name := strings.ToLower(req.URL.Query().Get(":article"))
 
 	context := make(map[string]string)
-	if article, exists := articles[article_name]; exists {
+	if article, exists := store.Get(article_name); exists {
 		context = article.CreateContext()
 	} else {
 		context = error_context(200, article_name, "Create the page")
 		context["Article.RawContent"] = ""
 	}
+
+	csrf_token, err := issue_csrf_cookie(res)
+	if err != nil {
+		context := error_context(500, "Internal server error", "Could not prepare the edit form")
+		res.WriteHeader(500)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+	context["CSRF.Token"] = csrf_token
+
 	context["content"] = render_template(edit_template, context)
 	fmt.Fprint(res, render_template(container_template, context))
 }
 
 func handle_search(res http.ResponseWriter, req *http.Request) {
-	fmt.Println("NONONO")
-	if que, ok := req.URL.Query()["article"]; ok {
-		if art, exists := articles[strings.ToLower(que[0])]; exists {
-			http.Redirect(res, req, "/"+art.Title, 301)
-			return
-		}
+	query := req.URL.Query().Get("article")
+
+	if art, exists := store.Get(strings.ToLower(query)); exists {
+		http.Redirect(res, req, "/"+art.Title, 301)
+		return
 	}
 
-	context := error_context(404, "Page not found", "Sorry, the page was not found")
-	res.WriteHeader(404)
-	context["content"] = render_template(error_template, context)
+	results := search_articles(query)
+	if len(results) == 0 {
+		context := error_context(404, "Page not found", "Sorry, no articles matched \""+query+"\"")
+		res.WriteHeader(404)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
+	context := error_context(200, "Search results", "")
+	context["Search.Query"] = query
+	context["Search.Results"] = render_search_results(results)
+	context["content"] = render_template(search_template, context)
 	fmt.Fprint(res, render_template(container_template, context))
 }
 
 func handle_save(res http.ResponseWriter, req *http.Request) {
+	if !check_csrf(req) {
+		context := error_context(403, "Forbidden", "That form has expired, please try again.")
+		res.WriteHeader(403)
+		context["content"] = render_template(error_template, context)
+		fmt.Fprint(res, render_template(container_template, context))
+		return
+	}
+
 	article_name := strings.ToLower(req.URL.Query().Get(":article"))
 	input_text := req.FormValue("textcontent")
 
 	if len(input_text) > 0 {
-		if article, ok := articles[article_name]; ok {
-			err := ioutil.WriteFile(cfg.Articles+article.Title+".md", []byte(input_text), 0644)
+		if article, ok := store.Get(article_name); ok {
+			modify_date := time.Now()
 			article.Content = input_text
-			article.ModifyDate = time.Now()
-			if err == nil {
-				articles[article_name] = article
+			article.ModifyDate = modify_date
+			if err := store.Put(article); err == nil {
+				index_article(article)
+				if _, err := snapshot_revision(article.Title, input_text, modify_date); err != nil {
+					fmt.Println("Failed to record revision for " + article.Title)
+				}
 				http.Redirect(res, req, "/"+article.Title, 301)
 				return
 			}
@@ -228,9 +268,11 @@ func handle_save(res http.ResponseWriter, req *http.Request) {
 			valid_name, _ := regexp.MatchString("([A-Za-z\\-]{1,64})", article_name)
 			if valid_name {
 				active_article := Article{article_name, time.Now(), input_text}
-				err := ioutil.WriteFile(cfg.Articles+active_article.Title+".md", []byte(input_text), 0644)
-				if err == nil {
-					articles[article_name] = active_article
+				if err := store.Put(active_article); err == nil {
+					index_article(active_article)
+					if _, err := snapshot_revision(active_article.Title, input_text, active_article.ModifyDate); err != nil {
+						fmt.Println("Failed to record revision for " + active_article.Title)
+					}
 					http.Redirect(res, req, "/"+active_article.Title, 301)
 					return
 				}
@@ -259,24 +301,76 @@ func load_config(path string) {
 func main() {
 	start_time := time.Now()
 
+	dev := flag.Bool("dev", false, "watch articles/templates and live-reload the browser on change")
+	flag.Parse()
+	dev_mode = *dev
+
 	load_config("config.json")
 	load_articles(cfg.Articles)
 	load_templates(cfg.Templates)
 
+	opened_auth, err := open_authenticator()
+	if err != nil {
+		log.Fatal("Failed to set up auth: " + err.Error())
+	}
+	auth = opened_auth
+
 	mux := pat.New()
 	mux.Get("/", http.HandlerFunc(handle_index))
 	mux.Get("/search", http.HandlerFunc(handle_search))
+	mux.Get("/feed.atom", http.HandlerFunc(handle_feed))
+	mux.Get("/:article/history", http.HandlerFunc(handle_history))
+	mux.Get("/:article/revision/:id", http.HandlerFunc(handle_revision))
+	mux.Get("/:article/diff/:a/:b", http.HandlerFunc(handle_diff))
 	mux.Get("/:article", http.HandlerFunc(handle_view))
 	if cfg.Editable {
-		mux.Get("/:article/edit", http.HandlerFunc(handle_edit))
-		mux.Post("/:article/save", http.HandlerFunc(handle_save))
+		mux.Get("/:article/edit", require_auth_middleware(handle_edit))
+		mux.Post("/:article/save", require_auth_middleware(handle_save))
+		mux.Post("/:article/revert/:id", require_auth_middleware(handle_revert))
+		if _, ok := auth.(*oauth_authenticator); ok {
+			mux.Get("/auth/callback", http.HandlerFunc(handle_oauth_callback))
+		}
 	}
+	if cfg.ActivityPub {
+		mux.Get("/.well-known/webfinger", http.HandlerFunc(handle_webfinger))
+		mux.Get("/actor", http.HandlerFunc(handle_actor))
+		mux.Get("/outbox", http.HandlerFunc(handle_outbox))
+		mux.Post("/inbox", http.HandlerFunc(handle_inbox))
+	}
+
+	http.Handle("/", dev_inject_middleware(mux))
 
-	http.Handle("/", mux)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.ActivityPub {
+		if err := setup_activitypub(ctx); err != nil {
+			log.Fatal("Failed to set up ActivityPub: " + err.Error())
+		}
+	}
+
+	if dev_mode {
+		http.HandleFunc("/_dev/reload", handle_dev_reload)
+		go watch_for_changes(ctx)
+		fmt.Println("Dev mode enabled: watching " + cfg.Articles + " and " + cfg.Templates)
+	}
 
 	diff_time := float32(time.Now().Nanosecond()-start_time.Nanosecond()) / 1000000.0
 	fmt.Printf("Server up and running after %f milliseconds\n", diff_time)
 
+	server := &http.Server{Addr: cfg.Host}
+
+	go func() {
+		<-ctx.Done()
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown_ctx); err != nil {
+			log.Println("Graceful shutdown failed: " + err.Error())
+		}
+	}()
+
 	// Run webserver
-	log.Fatal(http.ListenAndServe(cfg.Host, nil))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }